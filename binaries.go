@@ -0,0 +1,176 @@
+package go_ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Binaries names the ffmpeg and ffprobe executables to run, letting callers
+// pin a specific build instead of relying on $PATH
+type Binaries struct {
+	// FfmpegPath is the ffmpeg executable to run, passed to exec.CommandContext
+	FfmpegPath string
+
+	// FfprobePath is the ffprobe executable to run, passed to exec.CommandContext
+	FfprobePath string
+}
+
+// defaultBinaries is used until SetBinaries overrides it
+var defaultBinaries = Binaries{
+	FfmpegPath:  "ffmpeg",
+	FfprobePath: "ffprobe",
+}
+
+var (
+	binariesMu sync.RWMutex
+	binaries   = defaultBinaries
+)
+
+// SetBinaries overrides the package-level ffmpeg/ffprobe paths used by
+// NewFfmpeg, ProbeCapabilities, the HLS segmenter, and the thumbnail/sprite
+// APIs. A zero field falls back to the existing default for that binary
+func SetBinaries(b Binaries) {
+	binariesMu.Lock()
+	defer binariesMu.Unlock()
+
+	if b.FfmpegPath == "" {
+		b.FfmpegPath = binaries.FfmpegPath
+	}
+
+	if b.FfprobePath == "" {
+		b.FfprobePath = binaries.FfprobePath
+	}
+
+	binaries = b
+}
+
+// currentBinaries returns the package-level Binaries set by SetBinaries
+func currentBinaries() Binaries {
+	binariesMu.RLock()
+	defer binariesMu.RUnlock()
+
+	return binaries
+}
+
+// resolveBinaries merges override over the package-level Binaries, used by
+// Config.Binaries to let a single Ffmpeg pin a different build than the rest
+// of the process
+func resolveBinaries(override Binaries) Binaries {
+	resolved := currentBinaries()
+
+	if override.FfmpegPath != "" {
+		resolved.FfmpegPath = override.FfmpegPath
+	}
+
+	if override.FfprobePath != "" {
+		resolved.FfprobePath = override.FfprobePath
+	}
+
+	return resolved
+}
+
+// LookupBinaries verifies that the configured ffmpeg and ffprobe binaries
+// exist and are executable, returning a clear wrapped error instead of the
+// "executable file not found in $PATH" error a caller would otherwise only
+// see once they tried to run a conversion
+func LookupBinaries() error {
+	resolved := currentBinaries()
+
+	if _, err := exec.LookPath(resolved.FfmpegPath); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrBinaryNotFound, resolved.FfmpegPath, err)
+	}
+
+	if _, err := exec.LookPath(resolved.FfprobePath); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrBinaryNotFound, resolved.FfprobePath, err)
+	}
+
+	return nil
+}
+
+// Version is a parsed major.minor.patch version number, plus the configure
+// flags reported on the "configuration:" line of "-version" output
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+
+	// Raw is the unparsed first line of "-version" output. It is the only
+	// version information available for git snapshot builds, which report
+	// a commit count rather than a major.minor.patch release number
+	Raw string
+
+	// ConfigureFlags holds the individual "--enable-..."/"--disable-..."
+	// flags reported on the "configuration:" line
+	ConfigureFlags []string
+}
+
+// String formats v as "major.minor.patch"
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// releaseVersionPattern matches the leading major.minor.patch of a "name
+// version X.Y.Z-suffix ..." first line, tolerating a missing patch
+// component and the optional "n" prefix some distros build with
+var releaseVersionPattern = regexp.MustCompile(`version\s+n?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// gitVersionPattern matches the "name version N-<commits>-g<hash> ..." first
+// line ffmpeg reports for untagged git snapshot builds, which carry no
+// major.minor.patch release number at all
+var gitVersionPattern = regexp.MustCompile(`version\s+N-(\d+)-g[0-9a-f]+`)
+
+// configureFlagPattern matches the individual flags on a "configuration:
+// --enable-foo --disable-bar ..." line
+var configureFlagPattern = regexp.MustCompile(`--\S+`)
+
+// FfmpegVersion runs "ffmpeg -version" and parses its first line into a Version
+func FfmpegVersion(ctx context.Context) (Version, error) {
+	return probeVersion(ctx, currentBinaries().FfmpegPath)
+}
+
+// FfprobeVersion runs "ffprobe -version" and parses its first line into a Version
+func FfprobeVersion(ctx context.Context) (Version, error) {
+	return probeVersion(ctx, currentBinaries().FfprobePath)
+}
+
+// probeVersion runs binaryPath -version and parses the major.minor.patch
+// version number and configure flags out of its output
+func probeVersion(ctx context.Context, binaryPath string) (Version, error) {
+	output, err := exec.CommandContext(ctx, binaryPath, "-version").Output()
+	if err != nil {
+		return Version{}, ErrVersionCommand
+	}
+
+	firstLine, _, _ := strings.Cut(string(output), "\n")
+
+	version := Version{Raw: strings.TrimSpace(firstLine)}
+
+	switch matches := releaseVersionPattern.FindStringSubmatch(firstLine); {
+	case matches != nil:
+		version.Major, _ = strconv.Atoi(matches[1])
+		version.Minor, _ = strconv.Atoi(matches[2])
+		// The patch component is optional, e.g. a "6.0" release reports just "major.minor"
+		if matches[3] != "" {
+			version.Patch, _ = strconv.Atoi(matches[3])
+		}
+	case gitVersionPattern.MatchString(firstLine):
+		// Untagged git snapshot builds carry no release number, only Raw
+		// is meaningful; Major/Minor/Patch stay zero
+	default:
+		return Version{}, ErrVersionParse
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if configuration, ok := strings.CutPrefix(strings.TrimSpace(line), "configuration:"); ok {
+			version.ConfigureFlags = configureFlagPattern.FindAllString(configuration, -1)
+			break
+		}
+	}
+
+	return version, nil
+}
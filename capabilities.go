@@ -0,0 +1,248 @@
+package go_ffmpeg
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// softwareEncoders maps a codec family to the software encoder used when no
+// hardware encoder is available for it
+var softwareEncoders = map[string]string{
+	"h264": "libx264",
+	"hevc": "libx265",
+	"vp9":  "libvpx-vp9",
+	"av1":  "libaom-av1",
+}
+
+// hardwareEncoderPreference lists the hwaccel backends SelectHardwareEncoder
+// tries, in order, along with the encoder name suffix and init args each one
+// needs before -i
+var hardwareEncoderPreference = []struct {
+	hwaccel string
+	suffix  string
+	args    []string
+}{
+	{hwaccel: "cuda", suffix: "nvenc", args: []string{"-hwaccel", "cuda", "-hwaccel_output_format", "cuda"}},
+	{hwaccel: "vaapi", suffix: "vaapi", args: []string{"-hwaccel", "vaapi"}},
+	{hwaccel: "qsv", suffix: "qsv", args: []string{"-hwaccel", "qsv"}},
+	{hwaccel: "videotoolbox", suffix: "videotoolbox", args: []string{"-hwaccel", "videotoolbox"}},
+	// AMF is an encoder, not an hwaccel, so "ffmpeg -hwaccels" never lists it;
+	// gate on d3d11va, the hwaccel its init args actually request
+	{hwaccel: "d3d11va", suffix: "amf", args: []string{"-hwaccel", "d3d11va"}},
+	{hwaccel: "v4l2m2m", suffix: "v4l2m2m", args: []string{"-hwaccel", "v4l2m2m"}},
+}
+
+// Capabilities describes what the configured ffmpeg build supports, probed
+// once via ProbeCapabilities and cached for the lifetime of the process
+type Capabilities struct {
+	// Hwaccels lists the hardware acceleration methods ffmpeg -hwaccels reported
+	Hwaccels []string
+
+	// Encoders lists the available encoder names keyed by codec family, e.g.
+	// Encoders["h264"] might contain "libx264" and "h264_nvenc"
+	Encoders map[string][]string
+
+	// Muxers lists the short names ffmpeg -formats reported support for muxing
+	Muxers []string
+}
+
+var (
+	capabilitiesMu     sync.Mutex
+	cachedCapabilities *Capabilities
+)
+
+// ProbeCapabilities shells out to ffmpeg -hwaccels, -encoders, and -formats
+// once and caches the result for the lifetime of the process
+func ProbeCapabilities(ctx context.Context) (*Capabilities, error) {
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+
+	if cachedCapabilities != nil {
+		return cachedCapabilities, nil
+	}
+
+	hwaccelsOutput, err := runFfmpegProbe(ctx, "-hide_banner", "-hwaccels")
+	if err != nil {
+		return nil, err
+	}
+
+	encodersOutput, err := runFfmpegProbe(ctx, "-hide_banner", "-encoders")
+	if err != nil {
+		return nil, err
+	}
+
+	formatsOutput, err := runFfmpegProbe(ctx, "-hide_banner", "-formats")
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities := &Capabilities{
+		Hwaccels: parseHwaccels(hwaccelsOutput),
+		Encoders: parseEncoders(encodersOutput),
+		Muxers:   parseMuxers(formatsOutput),
+	}
+
+	cachedCapabilities = capabilities
+
+	return capabilities, nil
+}
+
+// runFfmpegProbe runs ffmpeg with the given arguments and returns its
+// stdout, wrapping any failure as ErrCapabilitiesProbe
+func runFfmpegProbe(ctx context.Context, args ...string) (string, error) {
+	output, err := exec.CommandContext(ctx, currentBinaries().FfmpegPath, args...).Output()
+	if err != nil {
+		return "", ErrCapabilitiesProbe
+	}
+
+	return string(output), nil
+}
+
+// parseHwaccels parses the output of ffmpeg -hwaccels, which is a header
+// line followed by one hwaccel name per line
+func parseHwaccels(output string) []string {
+	var hwaccels []string
+
+	for i, line := range strings.Split(output, "\n") {
+		// The first line is the "Hardware acceleration methods:" header
+		if i == 0 {
+			continue
+		}
+
+		if line = strings.TrimSpace(line); line != "" {
+			hwaccels = append(hwaccels, line)
+		}
+	}
+
+	return hwaccels
+}
+
+// parseEncoders parses the output of ffmpeg -encoders into a map of codec
+// family to the available encoder names for it, using the well known
+// software and hwaccel-suffixed encoder names to work out the family
+func parseEncoders(output string) map[string][]string {
+	encoders := make(map[string][]string)
+
+	// The legend precedes a line of dashes, the encoder table follows it
+	inTable := false
+
+	for _, line := range strings.Split(output, "\n") {
+		if !inTable {
+			if strings.HasPrefix(strings.TrimSpace(line), "---") {
+				inTable = true
+			}
+
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		name := fields[1]
+
+		codec, ok := encoderCodec(name)
+		if !ok {
+			continue
+		}
+
+		encoders[codec] = append(encoders[codec], name)
+	}
+
+	return encoders
+}
+
+// encoderCodec works out the codec family an encoder name belongs to, either
+// because it is a known software encoder or because it follows ffmpeg's
+// "<codec>_<backend>" hwaccel naming convention
+func encoderCodec(name string) (string, bool) {
+	for codec, encoder := range softwareEncoders {
+		if name == encoder {
+			return codec, true
+		}
+	}
+
+	for _, preference := range hardwareEncoderPreference {
+		if codec, ok := strings.CutSuffix(name, "_"+preference.suffix); ok {
+			return codec, true
+		}
+	}
+
+	return "", false
+}
+
+// parseMuxers parses the output of ffmpeg -formats, keeping only the names
+// flagged "E" for mux support
+func parseMuxers(output string) []string {
+	var muxers []string
+
+	inTable := false
+
+	for _, line := range strings.Split(output, "\n") {
+		if !inTable {
+			if strings.HasPrefix(strings.TrimSpace(line), "--") {
+				inTable = true
+			}
+
+			continue
+		}
+
+		if len(line) < 4 {
+			continue
+		}
+
+		flags := line[:3]
+		if !strings.Contains(flags, "E") {
+			continue
+		}
+
+		fields := strings.Fields(line[3:])
+		if len(fields) == 0 {
+			continue
+		}
+
+		muxers = append(muxers, strings.Split(fields[0], ",")...)
+	}
+
+	return muxers
+}
+
+// SelectHardwareEncoder returns the best available encoder for codec, along
+// with the -hwaccel* arguments it needs (which must precede -i on the
+// command line). It tries each hwaccel backend ffmpeg reported support for
+// in hardwareEncoderPreference order and falls back to the software
+// encoder for codec if none match
+func SelectHardwareEncoder(ctx context.Context, codec string) (encoder string, initArgs []string, err error) {
+	capabilities, err := ProbeCapabilities(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	availableHwaccels := make(map[string]bool, len(capabilities.Hwaccels))
+	for _, hwaccel := range capabilities.Hwaccels {
+		availableHwaccels[hwaccel] = true
+	}
+
+	availableEncoders := make(map[string]bool, len(capabilities.Encoders[codec]))
+	for _, candidate := range capabilities.Encoders[codec] {
+		availableEncoders[candidate] = true
+	}
+
+	for _, preference := range hardwareEncoderPreference {
+		candidate := codec + "_" + preference.suffix
+
+		if availableHwaccels[preference.hwaccel] && availableEncoders[candidate] {
+			return candidate, preference.args, nil
+		}
+	}
+
+	softwareEncoder, ok := softwareEncoders[codec]
+	if !ok {
+		return "", nil, ErrUnsupportedCodec
+	}
+
+	return softwareEncoder, nil, nil
+}
@@ -0,0 +1,228 @@
+package go_ffmpeg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// containerExtensions maps a Container name to the file extension ffmpeg
+// conventionally uses for it, for containers where the two differ
+var containerExtensions = map[string]string{
+	"matroska": ".mkv",
+}
+
+// Config describes how NewFfmpegWithConfig should transcode an input file,
+// replacing the raw ffmpeg argv callers previously had to build by hand
+type Config struct {
+	// Video encoder to pass to -c:v, e.g. "libx264". Leave empty to let
+	// ffmpeg choose the default encoder for Container, or let HardwareAccel
+	// pick one for Codec
+	Encoder string
+
+	// Codec family to encode video as, e.g. "h264". Used together with
+	// HardwareAccel to pick an encoder via SelectHardwareEncoder; ignored
+	// if Encoder is set explicitly
+	Codec string
+
+	// Hardware acceleration preference for Codec. Defaults to AccelNone,
+	// meaning Encoder (or ffmpeg's default) is used as-is
+	HardwareAccel HardwareAccel
+
+	// Audio encoder to pass to -c:a, e.g. "aac"
+	AudioEncoder string
+
+	// Output container, passed to ffmpeg as -f and used to derive
+	// FileExtension when that is not set, e.g. "mp4", "matroska"
+	Container string
+
+	// Output file extension, including the leading dot. Overrides the
+	// extension that would otherwise be derived from Container
+	FileExtension string
+
+	// Target video bitrate, e.g. "2M", passed to -b:v. Mutually exclusive
+	// with CRF
+	VideoBitrate string
+
+	// Target audio bitrate, e.g. "192k", passed to -b:a
+	AudioBitrate string
+
+	// Constant Rate Factor for quality based encoding, passed to -crf.
+	// Mutually exclusive with VideoBitrate. A nil CRF leaves quality to
+	// the encoder's default
+	CRF *int
+
+	// Audio sample rate in Hz, passed to -ar
+	SampleRate int
+
+	// Number of audio channels, passed to -ac
+	Channels int
+
+	// Pixel format, passed to -pix_fmt, e.g. "yuv420p"
+	PixelFormat string
+
+	// Extra raw ffmpeg output options, appended after the options Config
+	// generates
+	ExtraArgs []string
+
+	// Full path to write the output to. If empty, NewFfmpegWithConfig
+	// derives one from the input file, placing it in a Converted
+	// subdirectory with the extension implied by Container/FileExtension
+	OutputPath string
+
+	// Whether to overwrite OutputPath if it already exists. If false and
+	// the output file exists, NewFfmpegWithConfig returns ErrOutputFileExists
+	Overwrite bool
+
+	// Binaries overrides the package-level ffmpeg/ffprobe paths set by
+	// SetBinaries for this Ffmpeg only. A zero field falls back to the
+	// package-level path for that binary
+	Binaries Binaries
+}
+
+// HardwareAccel selects whether NewFfmpegWithConfig should try to pick a
+// hardware encoder for Config.Codec
+type HardwareAccel string
+
+const (
+	// AccelNone leaves encoder selection to Encoder/ffmpeg's defaults
+	AccelNone HardwareAccel = ""
+
+	// AccelAuto picks the best hardware encoder SelectHardwareEncoder finds
+	// for Codec, falling back to a software encoder if none is available
+	AccelAuto HardwareAccel = "auto"
+)
+
+// outputExtension returns the file extension NewFfmpegWithConfig should use
+// for the output file, preferring an explicit FileExtension over one
+// derived from Container
+func (c Config) outputExtension() string {
+	if c.FileExtension != "" {
+		if !strings.HasPrefix(c.FileExtension, ".") {
+			return "." + c.FileExtension
+		}
+
+		return c.FileExtension
+	}
+
+	if extension, ok := containerExtensions[c.Container]; ok {
+		return extension
+	}
+
+	if c.Container != "" {
+		return "." + c.Container
+	}
+
+	// Fall back to mp4 when neither FileExtension nor Container is set
+	return ".mp4"
+}
+
+// buildArgs builds the ffmpeg arguments described by the Config, returning
+// the options that must precede -i (hwaccel setup) separately from the
+// options that follow the input, e.g. the encoder and output settings
+func (c Config) buildArgs(ctx context.Context) (preInputArgs []string, outputArgs []string, err error) {
+	// CRF and VideoBitrate both control output quality/size and cannot be combined
+	if c.CRF != nil && c.VideoBitrate != "" {
+		return nil, nil, ErrMutuallyExclusiveOptions
+	}
+
+	encoder := c.Encoder
+
+	// Resolve a hardware encoder for Codec when one was not given explicitly
+	if encoder == "" && c.Codec != "" && c.HardwareAccel == AccelAuto {
+		encoder, preInputArgs, err = SelectHardwareEncoder(ctx, c.Codec)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	options := []string{}
+
+	if encoder != "" {
+		options = append(options, "-c:v", encoder)
+	}
+
+	if c.CRF != nil {
+		options = append(options, "-crf", strconv.Itoa(*c.CRF))
+	}
+
+	if c.VideoBitrate != "" {
+		options = append(options, "-b:v", c.VideoBitrate)
+	}
+
+	if c.PixelFormat != "" {
+		options = append(options, "-pix_fmt", c.PixelFormat)
+	}
+
+	if c.AudioEncoder != "" {
+		options = append(options, "-c:a", c.AudioEncoder)
+	}
+
+	if c.AudioBitrate != "" {
+		options = append(options, "-b:a", c.AudioBitrate)
+	}
+
+	if c.SampleRate != 0 {
+		options = append(options, "-ar", strconv.Itoa(c.SampleRate))
+	}
+
+	if c.Channels != 0 {
+		options = append(options, "-ac", strconv.Itoa(c.Channels))
+	}
+
+	if c.Container != "" {
+		options = append(options, "-f", c.Container)
+	}
+
+	// Append any caller-supplied options last so they can override the above
+	options = append(options, c.ExtraArgs...)
+
+	return preInputArgs, options, nil
+}
+
+// NewFfmpegWithConfig creates an Ffmpeg that converts inputFile according to
+// cfg. Unlike NewFfmpeg, the caller gets full control over the output
+// location, container, and encoder options instead of the hardcoded
+// Converted/<name>.mp4 behaviour
+func NewFfmpegWithConfig(cancelContext context.Context, inputFile string, cfg Config) (*Ffmpeg, error) {
+	// Check if the input file exists
+	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Determine the output file, deriving one from the input file if the
+	// caller did not supply OutputPath
+	outputFile := cfg.OutputPath
+	if outputFile == "" {
+		outputFile = filepath.Join(filepath.Dir(inputFile), "Converted", filepath.Base(inputFile))
+		outputFile = strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + cfg.outputExtension()
+	}
+
+	// If the output file already exists, only proceed when Overwrite is set
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		if !cfg.Overwrite {
+			return nil, ErrOutputFileExists
+		}
+	}
+
+	// Create the output directory if it does not exist
+	if err := os.MkdirAll(filepath.Dir(outputFile), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	// Build the ffmpeg arguments from the Config
+	preInputArgs, options, err := cfg.buildArgs(cancelContext)
+	if err != nil {
+		return nil, err
+	}
+
+	// Overwrite without prompting when the caller asked for it, ffmpeg
+	// would otherwise block waiting on stdin to confirm
+	if cfg.Overwrite {
+		preInputArgs = append([]string{"-y"}, preInputArgs...)
+	}
+
+	return newFfmpeg(cancelContext, inputFile, outputFile, preInputArgs, options, resolveBinaries(cfg.Binaries))
+}
@@ -5,16 +5,6 @@ import "errors"
 // Errors that can be returned by the progress parser
 var (
 	ErrNoProgressInformation = errors.New("no progress information")
-	ErrWrongNumberOfFields   = errors.New("line does not contain the correct number of fields")
-	ErrFrameNumber           = errors.New("could not parse frame number")
-	ErrFPS                   = errors.New("could not parse FPS")
-	ErrQ                     = errors.New("could not parse Q value")
-	ErrSize                  = errors.New("could not parse size")
-	ErrTime                  = errors.New("could not parse time")
-	ErrBitrate               = errors.New("could not parse bitrate")
-	ErrDup                   = errors.New("could not parse dup")
-	ErrDrop                  = errors.New("could not parse drop")
-	ErrSpeed                 = errors.New("could not parse speed")
 )
 
 // Errors that can be returned by the ffmpeg command
@@ -22,5 +12,49 @@ var (
 	ErrFfProbeStdOutPipe = errors.New("could not create ffprobe stdout pipe")
 	ErrStdErrPipe        = errors.New("could not create stderr pipe")
 	ErrFfProbeCommand    = errors.New("could not create ffprobe command")
+	ErrFfProbeUnmarshal  = errors.New("could not unmarshal ffprobe output")
 	ErrFfProbeDuration   = errors.New("could not get duration from ffprobe")
+	ErrProgressPipe      = errors.New("could not create progress pipe")
+	ErrOutputFileExists  = errors.New("output file already exists")
+)
+
+// Errors that can be returned when building a Config
+var (
+	ErrMutuallyExclusiveOptions = errors.New("VideoBitrate and CRF are mutually exclusive")
+)
+
+// Errors that can be returned by the Capabilities subsystem
+var (
+	ErrCapabilitiesProbe = errors.New("could not probe ffmpeg capabilities")
+	ErrUnsupportedCodec  = errors.New("no hardware or software encoder available for codec")
+)
+
+// Errors that can be returned by the HLS segmenter
+var (
+	ErrNoRenditions      = errors.New("at least one rendition is required")
+	ErrFfProbeKeyframes  = errors.New("could not probe keyframe timestamps")
+	ErrHLSSegment        = errors.New("could not create HLS segment")
+	ErrMasterPlaylist    = errors.New("could not write master playlist")
+	ErrRenditionPlaylist = errors.New("could not write rendition playlist")
+)
+
+// Errors that can be returned by the thumbnail and sprite sheet APIs
+var (
+	ErrUnsupportedImageFormat = errors.New("unsupported image format")
+	ErrThumbnailExtraction    = errors.New("could not extract thumbnail")
+	ErrInvalidSpriteGrid      = errors.New("sprite grid must have at least one column and row")
+	ErrInvalidSpriteInterval  = errors.New("sprite interval must be greater than zero")
+	ErrSpriteExtraction       = errors.New("could not extract sprite tile")
+)
+
+// Errors that can be returned by the Binaries subsystem
+var (
+	ErrBinaryNotFound = errors.New("binary not found")
+	ErrVersionCommand = errors.New("could not run -version")
+	ErrVersionParse   = errors.New("could not parse version")
+)
+
+// Errors that can be returned by the job Pool
+var (
+	ErrJobNotFound = errors.New("job not found")
 )
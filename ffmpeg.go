@@ -4,10 +4,8 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
-	"errors"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -52,46 +50,38 @@ type ffProbeOutput struct {
 	Format format `json:"format"`
 }
 
+// NewFfmpeg creates an Ffmpeg that converts inputFile to an mp4 in a
+// Converted subdirectory next to it, passing command straight through as
+// ffmpeg output options. It is a thin wrapper around NewFfmpegWithConfig
+// for callers who do not need the structured Config.
 func NewFfmpeg(cancelContext context.Context, inputFile string, command []string) (*Ffmpeg, error) {
-	// Check if the input file exists
-	_, err := os.Stat(inputFile)
-	if os.IsNotExist(err) {
-		return nil, err
-	}
-
-	// Set the output file to the Converted subdirectory of the directory the input file is in with the same name as the input file
-	outputFile := filepath.Join(filepath.Dir(inputFile), "Converted", filepath.Base(inputFile))
-
-	// Change the output file extension to .mp4
-	outputFile = strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + ".mp4"
+	return NewFfmpegWithConfig(cancelContext, inputFile, Config{
+		Container: "mp4",
+		ExtraArgs: command,
+	})
+}
 
-	// If the output file already exists, return an error
-	_, err = os.Stat(outputFile)
-	if !os.IsNotExist(err) {
-		return nil, ErrOutputFileExists
-	}
+// newFfmpeg builds the Ffmpeg struct shared by NewFfmpeg and
+// NewFfmpegWithConfig: it runs ffprobe to find the input duration and
+// wires up the ffmpeg subprocess with the given output options
+func newFfmpeg(cancelContext context.Context, inputFile string, outputFile string, preInputArgs []string, options []string, binaries Binaries) (*Ffmpeg, error) {
+	// Build the command line options, preInputArgs (e.g. -hwaccel flags) must
+	// come before -i
+	args := append([]string{}, preInputArgs...)
+	args = append(args, "-i", inputFile)
 
-	// Create the output directory if it does not exist
-	outputDirectory := filepath.Dir(outputFile)
-	if err = os.MkdirAll(outputDirectory, os.ModePerm); err != nil {
-		return nil, err
-	}
+	// Append the caller-supplied options
+	args = append(args, options...)
 
-	// Build the command line options
-	options := []string{
-		"-y",
-		"-i",
-		inputFile,
-	}
-
-	// Append the command options
-	options = append(options, command...)
+	// Ask ffmpeg to write machine-readable progress to fd 3, which is wired
+	// up to an os.Pipe in Start via cmd.ExtraFiles
+	args = append(args, "-progress", "pipe:3")
 
 	// Append the output file
-	options = append(options, outputFile)
+	args = append(args, outputFile)
 
 	// Create a subprocess to run ffmpeg
-	cmd := exec.CommandContext(cancelContext, "ffmpeg", options...)
+	cmd := exec.CommandContext(cancelContext, binaries.FfmpegPath, args...)
 
 	// Create a channel to send the progress
 	progressChannel := make(chan Progress)
@@ -102,9 +92,35 @@ func NewFfmpeg(cancelContext context.Context, inputFile string, command []string
 	// Create a channel to send done signal
 	doneChannel := make(chan bool)
 
+	// Get the duration of the input file with ffprobe
+	duration, err := probeDuration(inputFile, binaries.FfprobePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the ffmpeg struct
+	ffmpeg := &Ffmpeg{
+		inputFile:  inputFile,
+		outputFile: outputFile,
+		command:    cmd,
+		duration:   duration,
+		startTime:  time.Now(),
+		Progress:   progressChannel,
+		Error:      errorChannel,
+		Done:       doneChannel,
+		context:    cancelContext,
+	}
+
+	// Return the ffmpeg struct
+	return ffmpeg, nil
+}
+
+// probeDuration runs ffprobe against inputFile and returns its duration,
+// shared by newFfmpeg, the HLS segmenter, and the thumbnail/sprite APIs
+func probeDuration(inputFile string, ffprobePath string) (time.Duration, error) {
 	// Get the input file details with ffprobe
 	ffprobe := exec.Command(
-		"ffprobe",
+		ffprobePath,
 		"-print_format",
 		"json",
 		"-show_format",
@@ -114,7 +130,7 @@ func NewFfmpeg(cancelContext context.Context, inputFile string, command []string
 	// Get the output pipe
 	ffprobeOutput, err := ffprobe.StdoutPipe()
 	if err != nil {
-		return nil, ErrFfProbeStdOutPipe
+		return 0, ErrFfProbeStdOutPipe
 	}
 
 	// Defer closing the output pipe
@@ -122,7 +138,7 @@ func NewFfmpeg(cancelContext context.Context, inputFile string, command []string
 
 	// Start the ffprobe command
 	if err = ffprobe.Start(); err != nil {
-		return nil, ErrFfProbeCommand
+		return 0, ErrFfProbeCommand
 	}
 
 	// Create a scanner to read the output
@@ -137,33 +153,26 @@ func NewFfmpeg(cancelContext context.Context, inputFile string, command []string
 	// Unmarshal the output
 	var output ffProbeOutput
 	if err = json.Unmarshal([]byte(outputString), &output); err != nil {
-		return nil, ErrFfProbeUnmarshal
+		return 0, ErrFfProbeUnmarshal
 	}
 
 	// Convert the duration string to a float64
 	durationSeconds, err := strconv.ParseFloat(output.Format.Duration, 64)
 	if err != nil {
-		return nil, ErrFfProbeDuration
+		return 0, ErrFfProbeDuration
 	}
 
 	// Convert the duration to a time.Duration
-	duration := time.Duration(durationSeconds * float64(time.Second))
-
-	// Create the ffmpeg struct
-	ffmpeg := &Ffmpeg{
-		inputFile:  inputFile,
-		outputFile: outputFile,
-		command:    cmd,
-		duration:   duration,
-		startTime:  time.Now(),
-		Progress:   progressChannel,
-		Error:      errorChannel,
-		Done:       doneChannel,
-		context:    cancelContext,
-	}
+	return time.Duration(durationSeconds * float64(time.Second)), nil
+}
 
-	// Return the ffmpeg struct
-	return ffmpeg, nil
+// closeChannels closes Progress, Error and Done. It is used on Start's
+// early error paths, where the goroutine that defers cleanUp is never
+// launched and so would otherwise leave those channels open forever
+func (f *Ffmpeg) closeChannels() {
+	close(f.Progress)
+	close(f.Error)
+	close(f.Done)
 }
 
 func (f *Ffmpeg) cleanUp() {
@@ -201,67 +210,103 @@ func (f *Ffmpeg) cleanUp() {
 }
 
 func (f *Ffmpeg) Start() error {
-	// Create a reader to read the output from stderr
+	// Create a pipe to receive ffmpeg's machine-readable progress stream,
+	// the write end is handed to the child as fd 3 via ExtraFiles to match
+	// the "-progress pipe:3" option added in newFfmpeg
+	progressReader, progressWriter, err := os.Pipe()
+	if err != nil {
+		f.closeChannels()
+		return ErrProgressPipe
+	}
+
+	// Wire the write end up as the child's third extra file (fd 3)
+	f.command.ExtraFiles = []*os.File{progressWriter}
+
+	// Create a reader to drain stderr, it is only used for logging and
+	// error context now that progress is read from the pipe above
 	stderr, err := f.command.StderrPipe()
 	if err != nil {
+		progressReader.Close()
+		progressWriter.Close()
+		f.closeChannels()
 		return ErrStdErrPipe
 	}
 
-	// Defer closing the stderr pipe
-	defer stderr.Close()
+	// Start the ffmpeg command
+	if err = f.command.Start(); err != nil {
+		progressReader.Close()
+		progressWriter.Close()
+		f.closeChannels()
+		return err
+	}
+
+	// Close the parent's copy of the write end now the child has its own
+	if err = progressWriter.Close(); err != nil {
+		progressReader.Close()
+		f.closeChannels()
+		return err
+	}
 
-	// Create a reader to read the output
-	stdErrScanner := bufio.NewReader(stderr)
+	// Drain stderr in the background so ffmpeg is never blocked writing to it
+	go func() {
+		stdErrScanner := bufio.NewScanner(stderr)
+		for stdErrScanner.Scan() {
+			// Discard the line, ffmpeg's human readable log is no longer parsed for progress
+		}
+	}()
 
-	// Start a goroutine to read the output
+	// Start a goroutine to read the progress pipe
 	go func() {
-		// Read the output
-		for {
-			// Read the line
-			line, err := stdErrScanner.ReadString('\r')
-			if err != nil {
-				// Cancel the ffmpeg command
-				f.cleanUp()
-
-				// Return
-				return
+		// Defer closing the read end and cleaning up the Ffmpeg struct
+		defer progressReader.Close()
+		defer f.cleanUp()
+
+		// Accumulate key=value pairs between "progress=" markers
+		fields := make(map[string]string)
+
+		progressScanner := bufio.NewScanner(progressReader)
+		for progressScanner.Scan() {
+			// Split the line into its key and value
+			key, value, found := strings.Cut(progressScanner.Text(), "=")
+			if !found {
+				continue
 			}
 
-			// Log the output
-			progress, err := newProgress(line, f.duration, f.startTime, f.inputFile, f.outputFile)
-			if err != nil {
-				// Do not send an error if the progress information is not available
-				if !errors.Is(err, ErrNoProgressInformation) {
+			// The progress key terminates a block of key=value pairs
+			if key == "progress" {
+				progress, err := newProgress(fields, f.duration, f.startTime, f.inputFile, f.outputFile)
+				if err != nil {
 					// Send an error to the error channel
 					select {
 					case f.Error <- err:
 					default:
 					}
+				} else {
+					// Try to send the progress to the channel, if there is no listener continue to the next iteration
+					select {
+					case f.Progress <- *progress:
+					default:
+					}
+				}
 
-					// Cancel the ffmpeg command
-					f.command.Cancel()
-
-					// Clean up
-					f.cleanUp()
-
-					// Return
+				// ffmpeg signals the end of the stream with progress=end
+				if value == "end" {
 					return
-				} else {
-					// Continue to the next iteration
-					continue
 				}
-			}
 
-			// Try to send the progress to the channel, if there is no listener continue to the next iteration
-			select {
-			case f.Progress <- *progress:
-			default:
+				// Reset the accumulated fields for the next block
+				fields = make(map[string]string)
+
+				continue
 			}
+
+			// Accumulate the field, trimming the whitespace ffmpeg pads some values with
+			fields[key] = strings.TrimSpace(value)
 		}
 	}()
 
-	// Run the command
-	if err = f.command.Run(); err != nil {
+	// Wait for the command to finish
+	if err = f.command.Wait(); err != nil {
 		return err
 	}
 
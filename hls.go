@@ -0,0 +1,523 @@
+package go_ffmpeg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rendition describes one quality level of an HLS ladder
+type Rendition struct {
+	// Name identifies the rendition, used as its output subdirectory and in
+	// progress records, e.g. "480p"
+	Name string
+
+	// Width of the rendition in pixels
+	Width int
+
+	// Height of the rendition in pixels
+	Height int
+
+	// VideoBitrate target for this rendition, e.g. "1500k", passed to -b:v
+	VideoBitrate string
+
+	// AudioBitrate target for this rendition, e.g. "128k", passed to -b:a
+	AudioBitrate string
+}
+
+// HLSOptions configures NewHLS
+type HLSOptions struct {
+	// Renditions to produce, from lowest to highest quality
+	Renditions []Rendition
+
+	// SegmentDuration is the target length of each HLS segment. Segments
+	// are snapped to the nearest following keyframe so they stay
+	// independently decodable, so actual segment lengths vary slightly
+	SegmentDuration time.Duration
+
+	// OutputDir is the directory the master playlist, rendition playlists,
+	// and segment files are written to
+	OutputDir string
+}
+
+// RenditionProgress reports Progress for a single rendition of an HLS job
+type RenditionProgress struct {
+	// Rendition this progress record is for
+	Rendition string
+
+	Progress
+}
+
+// HLS produces adaptive HLS output (a master playlist, per-rendition
+// playlists, and keyframe-aligned segments) from a single input file
+type HLS struct {
+	// The input file
+	inputFile string
+
+	// Directory the playlists and segments are written to
+	outputDir string
+
+	// Duration of the input file
+	duration time.Duration
+
+	// Renditions to produce
+	renditions []Rendition
+
+	// Target segment duration
+	segmentDuration time.Duration
+
+	// Progress channel, tagged with the rendition each record belongs to
+	Progress chan RenditionProgress
+
+	// Error channel
+	Error chan error
+
+	// Done channel
+	Done chan bool
+
+	// Cancel context
+	context context.Context
+}
+
+// NewHLS probes inputFile and prepares an HLS job that will, once Start is
+// called, produce opts.Renditions as keyframe-aligned VOD segments plus a
+// master playlist in opts.OutputDir
+func NewHLS(cancelContext context.Context, inputFile string, opts HLSOptions) (*HLS, error) {
+	// Check if the input file exists
+	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// At least one rendition is required to produce a master playlist
+	if len(opts.Renditions) == 0 {
+		return nil, ErrNoRenditions
+	}
+
+	// Create the output directory if it does not exist
+	if err := os.MkdirAll(opts.OutputDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	// Get the duration of the input file
+	duration, err := probeDuration(inputFile, currentBinaries().FfprobePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Default to a 6 second segment target, the common HLS VOD choice
+	segmentDuration := opts.SegmentDuration
+	if segmentDuration == 0 {
+		segmentDuration = 6 * time.Second
+	}
+
+	return &HLS{
+		inputFile:       inputFile,
+		outputDir:       opts.OutputDir,
+		duration:        duration,
+		renditions:      opts.Renditions,
+		segmentDuration: segmentDuration,
+		Progress:        make(chan RenditionProgress),
+		Error:           make(chan error),
+		Done:            make(chan bool),
+		context:         cancelContext,
+	}, nil
+}
+
+// keyframePacket is the shape of one entry in ffprobe's -show_entries
+// packet=pts_time,flags output
+type keyframePacket struct {
+	PtsTime string `json:"pts_time"`
+	Flags   string `json:"flags"`
+}
+
+type keyframeProbeOutput struct {
+	Packets []keyframePacket `json:"packets"`
+}
+
+// probeKeyframeTimes runs ffprobe to enumerate the presentation timestamps
+// of every keyframe in the first video stream, so segments can be aligned
+// on them and stay independently decodable
+func probeKeyframeTimes(inputFile string) ([]time.Duration, error) {
+	ffprobe := exec.Command(
+		currentBinaries().FfprobePath,
+		"-print_format",
+		"json",
+		"-select_streams",
+		"v:0",
+		"-show_entries",
+		"packet=pts_time,flags",
+		"-skip_frame",
+		"nokey",
+		inputFile,
+	)
+
+	ffprobeOutput, err := ffprobe.StdoutPipe()
+	if err != nil {
+		return nil, ErrFfProbeStdOutPipe
+	}
+	defer ffprobeOutput.Close()
+
+	if err = ffprobe.Start(); err != nil {
+		return nil, ErrFfProbeCommand
+	}
+
+	ffprobeOutputScanner := bufio.NewScanner(ffprobeOutput)
+
+	outputString := ""
+	for ffprobeOutputScanner.Scan() {
+		outputString += strings.TrimSpace(ffprobeOutputScanner.Text())
+	}
+
+	var output keyframeProbeOutput
+	if err = json.Unmarshal([]byte(outputString), &output); err != nil {
+		return nil, ErrFfProbeKeyframes
+	}
+
+	var keyframeTimes []time.Duration
+	for _, packet := range output.Packets {
+		// -skip_frame nokey should only return keyframes, but check the flag too
+		if !strings.Contains(packet.Flags, "K") {
+			continue
+		}
+
+		ptsSeconds, err := strconv.ParseFloat(packet.PtsTime, 64)
+		if err != nil {
+			return nil, ErrFfProbeKeyframes
+		}
+
+		keyframeTimes = append(keyframeTimes, time.Duration(ptsSeconds*float64(time.Second)))
+	}
+
+	return keyframeTimes, nil
+}
+
+// segmentBoundaries walks keyframeTimes and picks the first keyframe at or
+// after each multiple of segmentDuration, so every segment boundary falls
+// exactly on a keyframe
+func segmentBoundaries(keyframeTimes []time.Duration, segmentDuration time.Duration, duration time.Duration) []time.Duration {
+	var boundaries []time.Duration
+
+	next := segmentDuration
+	for _, keyframeTime := range keyframeTimes {
+		// Keyframes before the very start of the file cannot be a boundary
+		if keyframeTime <= 0 {
+			continue
+		}
+
+		if keyframeTime >= next {
+			boundaries = append(boundaries, keyframeTime)
+
+			// Skip past any further multiples this single keyframe also satisfies
+			for next <= keyframeTime {
+				next += segmentDuration
+			}
+		}
+	}
+
+	return boundaries
+}
+
+// cleanUp signals completion on the Done channel, mirroring Ffmpeg.cleanUp
+func (h *HLS) cleanUp(success bool) {
+	select {
+	case h.Done <- success:
+	default:
+	}
+
+	close(h.Progress)
+	close(h.Error)
+	close(h.Done)
+}
+
+// Start probes the input's keyframes, encodes each Rendition into
+// keyframe-aligned segments, and writes the rendition and master playlists
+func (h *HLS) Start() error {
+	keyframeTimes, err := probeKeyframeTimes(h.inputFile)
+	if err != nil {
+		h.cleanUp(false)
+		return err
+	}
+
+	boundaries := segmentBoundaries(keyframeTimes, h.segmentDuration, h.duration)
+
+	// Segment times are passed to ffmpeg's segment muxer as a comma
+	// separated list of split points
+	segmentTimesArg := make([]string, len(boundaries))
+	for i, boundary := range boundaries {
+		segmentTimesArg[i] = strconv.FormatFloat(boundary.Seconds(), 'f', 6, 64)
+	}
+
+	for _, rendition := range h.renditions {
+		select {
+		case <-h.context.Done():
+			h.cleanUp(false)
+			return h.context.Err()
+		default:
+		}
+
+		segmentDurations, err := h.runRendition(rendition, segmentTimesArg, boundaries)
+		if err != nil {
+			h.cleanUp(false)
+			return err
+		}
+
+		if err = writeRenditionPlaylist(h.outputDir, rendition, segmentDurations); err != nil {
+			h.cleanUp(false)
+			return err
+		}
+	}
+
+	if err = writeMasterPlaylist(h.outputDir, h.renditions); err != nil {
+		h.cleanUp(false)
+		return err
+	}
+
+	h.cleanUp(true)
+
+	return nil
+}
+
+// runRendition encodes a single Rendition to keyframe-aligned .ts segments,
+// returning the duration of each segment for the rendition playlist
+func (h *HLS) runRendition(rendition Rendition, segmentTimesArg []string, boundaries []time.Duration) ([]time.Duration, error) {
+	renditionDir := filepath.Join(h.outputDir, rendition.Name)
+	if err := os.MkdirAll(renditionDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-i", h.inputFile,
+		"-vf", fmt.Sprintf("scale=%d:%d", rendition.Width, rendition.Height),
+		"-c:v", "libx264",
+		"-b:v", rendition.VideoBitrate,
+		"-c:a", "aac",
+		"-b:a", rendition.AudioBitrate,
+		"-f", "segment",
+		"-segment_format", "mpegts",
+		"-reset_timestamps", "1",
+	}
+
+	if len(segmentTimesArg) > 0 {
+		// Force an output keyframe at each boundary. Without this, libx264
+		// picks its own GOP structure and the segment muxer only splits at
+		// the first output keyframe at-or-after each listed time, so the
+		// real .ts boundaries (and count) drift from the source-keyframe
+		// times segmentDurations used to build the rendition playlist
+		args = append(args, "-force_key_frames", strings.Join(segmentTimesArg, ","))
+		args = append(args, "-segment_times", strings.Join(segmentTimesArg, ","))
+	} else {
+		// No boundary survived segmentBoundaries (e.g. the file is shorter
+		// than one segmentDuration), so force a single segment covering the
+		// whole file instead of letting the segment muxer fall back to its
+		// default 2s segment_time, which would write many files the
+		// single-entry playlist below does not list
+		args = append(args, "-segment_time", strconv.FormatFloat((h.duration+time.Second).Seconds(), 'f', 6, 64))
+	}
+
+	args = append(args, "-progress", "pipe:3", filepath.Join(renditionDir, "segment%05d.ts"))
+
+	cmd := exec.CommandContext(h.context, currentBinaries().FfmpegPath, args...)
+
+	progressReader, progressWriter, err := os.Pipe()
+	if err != nil {
+		return nil, ErrProgressPipe
+	}
+	cmd.ExtraFiles = []*os.File{progressWriter}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, ErrStdErrPipe
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrHLSSegment, err)
+	}
+
+	if err = progressWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		stdErrScanner := bufio.NewScanner(stderr)
+		for stdErrScanner.Scan() {
+			// Discard the line, only used for logging/error context
+		}
+	}()
+
+	startTime := time.Now()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer progressReader.Close()
+
+		fields := make(map[string]string)
+
+		progressScanner := bufio.NewScanner(progressReader)
+		for progressScanner.Scan() {
+			key, value, found := strings.Cut(progressScanner.Text(), "=")
+			if !found {
+				continue
+			}
+
+			if key == "progress" {
+				progress, err := newProgress(fields, h.duration, startTime, h.inputFile, renditionDir)
+				if err == nil {
+					select {
+					case h.Progress <- RenditionProgress{Rendition: rendition.Name, Progress: *progress}:
+					default:
+					}
+				}
+
+				if value == "end" {
+					return
+				}
+
+				fields = make(map[string]string)
+
+				continue
+			}
+
+			fields[key] = strings.TrimSpace(value)
+		}
+	}()
+
+	if err = cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrHLSSegment, err)
+	}
+
+	<-done
+
+	return segmentDurations(boundaries, h.duration), nil
+}
+
+// segmentDurations turns a list of segment boundary times into the duration
+// of each segment they delimit, ending at duration
+func segmentDurations(boundaries []time.Duration, duration time.Duration) []time.Duration {
+	durations := make([]time.Duration, 0, len(boundaries)+1)
+
+	previous := time.Duration(0)
+	for _, boundary := range boundaries {
+		durations = append(durations, boundary-previous)
+		previous = boundary
+	}
+
+	durations = append(durations, duration-previous)
+
+	return durations
+}
+
+// writeRenditionPlaylist writes the VOD media playlist for a single rendition
+func writeRenditionPlaylist(outputDir string, rendition Rendition, segmentDurations []time.Duration) error {
+	var builder strings.Builder
+
+	builder.WriteString("#EXTM3U\n")
+	builder.WriteString("#EXT-X-VERSION:3\n")
+	builder.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+
+	longest := time.Duration(0)
+	for _, segmentDuration := range segmentDurations {
+		if segmentDuration > longest {
+			longest = segmentDuration
+		}
+	}
+	builder.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", int(longest.Seconds()+1)))
+
+	for i, segmentDuration := range segmentDurations {
+		builder.WriteString(fmt.Sprintf("#EXTINF:%.6f,\n", segmentDuration.Seconds()))
+		builder.WriteString(fmt.Sprintf("segment%05d.ts\n", i))
+	}
+
+	builder.WriteString("#EXT-X-ENDLIST\n")
+
+	playlistPath := filepath.Join(outputDir, rendition.Name, "playlist.m3u8")
+	if err := writeFileAtomically(playlistPath, []byte(builder.String())); err != nil {
+		return ErrRenditionPlaylist
+	}
+
+	return nil
+}
+
+// writeMasterPlaylist writes the master playlist listing every rendition
+func writeMasterPlaylist(outputDir string, renditions []Rendition) error {
+	var builder strings.Builder
+
+	builder.WriteString("#EXTM3U\n")
+	builder.WriteString("#EXT-X-VERSION:3\n")
+
+	for _, rendition := range renditions {
+		bandwidth := estimateBandwidth(rendition)
+
+		builder.WriteString(fmt.Sprintf(
+			"#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n",
+			bandwidth, rendition.Width, rendition.Height,
+		))
+		builder.WriteString(fmt.Sprintf("%s/playlist.m3u8\n", rendition.Name))
+	}
+
+	playlistPath := filepath.Join(outputDir, "master.m3u8")
+	if err := writeFileAtomically(playlistPath, []byte(builder.String())); err != nil {
+		return ErrMasterPlaylist
+	}
+
+	return nil
+}
+
+// estimateBandwidth sums a Rendition's video and audio bitrates for the
+// master playlist's BANDWIDTH attribute, in bits per second
+func estimateBandwidth(rendition Rendition) int {
+	return parseBitrate(rendition.VideoBitrate) + parseBitrate(rendition.AudioBitrate)
+}
+
+// parseBitrate parses an ffmpeg style bitrate string, e.g. "1500k" or "2M",
+// into bits per second, returning 0 if it cannot be parsed
+func parseBitrate(bitrate string) int {
+	multiplier := 1
+
+	switch {
+	case strings.HasSuffix(bitrate, "k"):
+		multiplier = 1_000
+		bitrate = strings.TrimSuffix(bitrate, "k")
+	case strings.HasSuffix(bitrate, "M"):
+		multiplier = 1_000_000
+		bitrate = strings.TrimSuffix(bitrate, "M")
+	}
+
+	value, err := strconv.Atoi(bitrate)
+	if err != nil {
+		return 0
+	}
+
+	return value * multiplier
+}
+
+// writeFileAtomically writes data to path by writing to a temporary file in
+// the same directory and renaming it into place, so readers never observe a
+// partially written playlist
+func writeFileAtomically(path string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+
+	if _, err = temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err = temp.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+}
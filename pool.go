@@ -0,0 +1,250 @@
+package go_ffmpeg
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// JobID identifies a job submitted to a Pool
+type JobID int
+
+// Job describes one conversion for a Pool to run
+type Job struct {
+	// InputFile to convert
+	InputFile string
+
+	// Config to convert InputFile with
+	Config Config
+}
+
+// JobStatus is a snapshot of a Job's state, returned by Pool.List
+type JobStatus struct {
+	// ID of the job
+	ID JobID
+
+	// InputFile the job was submitted with
+	InputFile string
+
+	// Running is true once the job's Ffmpeg has started
+	Running bool
+
+	// Done is true once the job has finished, successfully or otherwise
+	Done bool
+
+	// Err holds the job's failure, if any, once Done is true
+	Err error
+}
+
+// JobProgress tags a Progress record with the job it came from, so a Pool
+// can fan progress from every running job into a single channel
+type JobProgress struct {
+	// ID of the job this progress record is for
+	ID JobID
+
+	Progress
+}
+
+// JobError tags an error with the job it came from
+type JobError struct {
+	// ID of the job this error came from
+	ID JobID
+
+	Err error
+}
+
+// poolJob tracks the running Ffmpeg and cancel func for a submitted Job
+type poolJob struct {
+	ffmpeg *Ffmpeg
+	cancel context.CancelFunc
+}
+
+// Pool runs a bounded number of Ffmpeg conversions concurrently, so callers
+// do not have to manage a collection of Ffmpeg structs, their channels, and
+// cancellation contexts by hand
+type Pool struct {
+	// Cancel context jobs are derived from
+	context context.Context
+
+	// Bounds how many jobs run at once
+	semaphore chan struct{}
+
+	// Progress channel, fanned in from every running job
+	Progress chan JobProgress
+
+	// Error channel, fanned in from every running job
+	Error chan JobError
+
+	mu       sync.Mutex
+	nextID   JobID
+	running  map[JobID]*poolJob
+	statuses map[JobID]JobStatus
+	wg       sync.WaitGroup
+
+	// closed is set once Wait has closed Progress/Error, guarding against a
+	// job still fanning in from a Submit that raced with Wait
+	closed atomic.Bool
+}
+
+// NewPool creates a Pool that runs at most maxConcurrency jobs at once
+func NewPool(cancelContext context.Context, maxConcurrency int) *Pool {
+	return &Pool{
+		context:   cancelContext,
+		semaphore: make(chan struct{}, maxConcurrency),
+		Progress:  make(chan JobProgress),
+		Error:     make(chan JobError),
+		running:   make(map[JobID]*poolJob),
+		statuses:  make(map[JobID]JobStatus),
+	}
+}
+
+// Submit queues job to run as soon as a concurrency slot is free, returning
+// the JobID used to Cancel it or find it in List. The job is cancellable as
+// soon as Submit returns, even before it acquires a concurrency slot
+func (p *Pool) Submit(job Job) (JobID, error) {
+	jobContext, cancel := context.WithCancel(p.context)
+
+	p.mu.Lock()
+	p.nextID++
+	id := p.nextID
+	p.statuses[id] = JobStatus{ID: id, InputFile: job.InputFile}
+	p.running[id] = &poolJob{cancel: cancel}
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go p.run(id, job, jobContext, cancel)
+
+	return id, nil
+}
+
+// run waits for a concurrency slot, starts job's Ffmpeg, fans its Progress
+// and Error channels into the Pool's, and records the result in statuses
+func (p *Pool) run(id JobID, job Job, jobContext context.Context, cancel context.CancelFunc) {
+	defer p.wg.Done()
+	defer cancel()
+
+	select {
+	case p.semaphore <- struct{}{}:
+	case <-jobContext.Done():
+		p.cleanUp(id, jobContext.Err())
+		return
+	}
+	defer func() { <-p.semaphore }()
+
+	ffmpeg, err := NewFfmpegWithConfig(jobContext, job.InputFile, job.Config)
+	if err != nil {
+		p.cleanUp(id, err)
+		return
+	}
+
+	p.mu.Lock()
+	p.running[id] = &poolJob{ffmpeg: ffmpeg, cancel: cancel}
+	status := p.statuses[id]
+	status.Running = true
+	p.statuses[id] = status
+	p.mu.Unlock()
+
+	fanIn := sync.WaitGroup{}
+	fanIn.Add(2)
+
+	go func() {
+		defer fanIn.Done()
+		for progress := range ffmpeg.Progress {
+			p.sendProgress(JobProgress{ID: id, Progress: progress})
+		}
+	}()
+
+	go func() {
+		defer fanIn.Done()
+		for jobErr := range ffmpeg.Error {
+			p.sendError(JobError{ID: id, Err: jobErr})
+		}
+	}()
+
+	err = ffmpeg.Start()
+
+	// Progress/Error are closed by Ffmpeg.cleanUp, or by closeChannels on
+	// Start's early error paths, wait for the fan-in goroutines to see that
+	// before recording the final status
+	fanIn.Wait()
+
+	p.cleanUp(id, err)
+}
+
+// cleanUp records a job's final status and removes it from running
+func (p *Pool) cleanUp(id JobID, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.running, id)
+
+	status := p.statuses[id]
+	status.Running = false
+	status.Done = true
+	status.Err = err
+	p.statuses[id] = status
+}
+
+// Cancel cancels the running job identified by id, causing its Ffmpeg to
+// stop and its output file to be removed
+func (p *Pool) Cancel(id JobID) error {
+	p.mu.Lock()
+	job, ok := p.running[id]
+	p.mu.Unlock()
+
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	job.cancel()
+
+	return nil
+}
+
+// List returns a snapshot of every submitted job's status
+func (p *Pool) List() []JobStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(p.statuses))
+	for _, status := range p.statuses {
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// Wait blocks until every submitted job has finished, then closes Progress
+// and Error. Submit must not be called again once Wait has been called
+func (p *Pool) Wait() {
+	p.wg.Wait()
+
+	p.closed.Store(true)
+
+	close(p.Progress)
+	close(p.Error)
+}
+
+// sendProgress forwards jp to Progress unless Wait has already closed it
+func (p *Pool) sendProgress(jp JobProgress) {
+	if p.closed.Load() {
+		return
+	}
+
+	select {
+	case p.Progress <- jp:
+	default:
+	}
+}
+
+// sendError forwards je to Error unless Wait has already closed it
+func (p *Pool) sendError(je JobError) {
+	if p.closed.Load() {
+		return
+	}
+
+	select {
+	case p.Error <- je:
+	default:
+	}
+}
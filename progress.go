@@ -4,7 +4,6 @@ import (
 	"strconv"
 	"strings"
 	"time"
-	"unicode"
 )
 
 // Progress struct to parse and store the progress of the ffmpeg command
@@ -24,7 +23,7 @@ type Progress struct {
 	// Q value
 	Q float64 `json:"q"`
 
-	// Size of the output file
+	// Size of the output file in bytes
 	Size float64 `json:"size"`
 
 	// Time through the file
@@ -33,6 +32,12 @@ type Progress struct {
 	// Bitrate
 	Bitrate float64 `json:"bitrate"`
 
+	// Number of duplicated frames
+	DupFrames int `json:"dupFrames"`
+
+	// Number of dropped frames
+	DropFrames int `json:"dropFrames"`
+
 	// Conversion speed
 	Speed float64 `json:"speed"`
 
@@ -46,151 +51,44 @@ type Progress struct {
 	EstimatedFinishTime time.Time `json:"estimatedFinishTime"`
 }
 
-// Parse the progress information from the ffmpeg stderr output
-func newProgress(line string, duration time.Duration, startTime time.Time, inputFile string, outputFile string) (*Progress, error) {
-	// Declare the indexes for the fields
-	var frameIndex, fpsIndex, qIndex, sizeIndex, timeIndex, bitrateIndex, speedIndex int
-
-	// Declare the fields
-	var frame int
-	var fps, q, size, bitrate, speed float64
-	var timeThroughFile time.Duration
-	var hours, minutes int
-	var seconds float64
-
-	// Declare the error
-	var err error
-
-	// Check if the line contains progress information
-	if !strings.HasPrefix(line, "frame=") {
+// newProgress builds a Progress value from the key=value pairs ffmpeg wrote to
+// its "-progress pipe:" stream between two "progress=" markers. Fields ffmpeg
+// omits or reports as "N/A" (routine on the first block or two of a run) are
+// tolerated and simply left at their zero value rather than failing the
+// whole block
+func newProgress(fields map[string]string, duration time.Duration, startTime time.Time, inputFile string, outputFile string) (*Progress, error) {
+	if len(fields) == 0 {
 		return nil, ErrNoProgressInformation
 	}
 
-	// Fields function to split the line
-	fieldsFunc := func(c rune) bool {
-		return !unicode.IsLetter(c) && !unicode.IsNumber(c) && c != '.' && c != '-' && c != ':' && c != '/'
-	}
-
-	// Split the line
-	fields := strings.FieldsFunc(line, fieldsFunc)
-
-	// Loop through the fields extracting the values
-	for i, field := range fields {
-		fields[i] = strings.TrimSpace(field)
-
-		switch fields[i] {
-		case "frame":
-			frameIndex = i + 1
-		case "fps":
-			fpsIndex = i + 1
-		case "q":
-			qIndex = i + 1
-		case "size":
-			sizeIndex = i + 1
-		case "time":
-			timeIndex = i + 1
-		case "bitrate":
-			bitrateIndex = i + 1
-		case "speed":
-			speedIndex = i + 1
-		}
-	}
-
 	// Parse the frame number
-	if frameIndex != 0 && frameIndex < len(fields) {
-		if frame, err = strconv.Atoi(fields[frameIndex]); err != nil {
-			return nil, ErrFrameNumber
-		}
-	} else {
-		return nil, ErrFrameNumber
-	}
+	frame, _ := strconv.Atoi(fields["frame"])
 
 	// Parse the FPS
-	if fpsIndex != 0 && fpsIndex < len(fields) {
-		if fps, err = strconv.ParseFloat(fields[fpsIndex], 64); err != nil {
-			return nil, ErrFPS
-		}
-	} else {
-		return nil, ErrFPS
-	}
+	fps, _ := strconv.ParseFloat(fields["fps"], 64)
 
-	// Parse the Q value
-	if qIndex != 0 && qIndex < len(fields) {
-		if q, err = strconv.ParseFloat(fields[qIndex], 64); err != nil {
-			return nil, ErrQ
-		}
-	} else {
-		return nil, ErrQ
-	}
+	// Parse the Q value, reported against the first video stream
+	q, _ := strconv.ParseFloat(fields["stream_0_0_q"], 64)
 
-	// Parse the size
-	if sizeIndex != 0 && sizeIndex < len(fields) {
-		if size, err = strconv.ParseFloat(strings.TrimRight(fields[sizeIndex], "KiB"), 64); err != nil {
-			return nil, ErrSize
-		}
-	} else {
-		return nil, ErrSize
-	}
+	// Parse the total output size in bytes
+	size := parseFloatOrNA(fields["total_size"], "")
 
-	// Parse the time
-	if timeIndex != 0 && timeIndex < len(fields) {
-		// Set the time to 0 if it is N/A
-		if fields[timeIndex] == "N/A" {
-			timeThroughFile = time.Duration(0)
-		} else {
-			// Split the time into hours, minutes, and seconds
-			splitTime := strings.Split(fields[timeIndex], ":")
-
-			if len(splitTime) != 3 {
-				return nil, ErrTime
-			}
-			// Get the hours, minutes, and seconds
-			if hours, err = strconv.Atoi(splitTime[0]); err != nil {
-				return nil, ErrTime
-			}
-
-			if minutes, err = strconv.Atoi(splitTime[1]); err != nil {
-				return nil, ErrTime
-			}
-
-			if seconds, err = strconv.ParseFloat(splitTime[2], 64); err != nil {
-				return nil, ErrTime
-			}
-
-			// Calculate the time through the file
-			timeThroughFile = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
-		}
-	} else {
-		return nil, ErrTime
-	}
+	// Parse the time through the file, out_time_us is always reported in
+	// microseconds and does not suffer the truncated HH:MM:SS.xx rounding
+	// of out_time
+	timeThroughFile := time.Duration(parseFloatOrNA(fields["out_time_us"], "")) * time.Microsecond
 
-	// Parse the bitrate
-	if bitrateIndex != 0 && bitrateIndex < len(fields) {
-		// Handle the case where the bitrate is N/A
-		if fields[bitrateIndex] == "N/A" {
-			bitrate = 0
-		} else {
-			if bitrate, err = strconv.ParseFloat(strings.TrimRight(fields[bitrateIndex], "kbit/s"), 64); err != nil {
-				return nil, ErrBitrate
-			}
-		}
-	} else {
-		return nil, ErrBitrate
-	}
+	// Parse the bitrate, handling the case where it is N/A
+	bitrate := parseFloatOrNA(fields["bitrate"], "kbits/s")
 
-	// Parse the speed
-	if speedIndex != 0 && speedIndex < len(fields) {
-		// Handle the case where the speed is N/A
-		if fields[speedIndex] == "N/A" {
-			speed = 0
-		} else {
-			if speed, err = strconv.ParseFloat(strings.TrimRight(fields[speedIndex], "x"), 64); err != nil {
-				return nil, ErrSpeed
-			}
-		}
-	} else {
-		return nil, ErrSpeed
-	}
+	// Parse the number of duplicated frames
+	dupFrames, _ := strconv.Atoi(fields["dup_frames"])
+
+	// Parse the number of dropped frames
+	dropFrames, _ := strconv.Atoi(fields["drop_frames"])
+
+	// Parse the speed, handling the case where it is N/A
+	speed := parseFloatOrNA(fields["speed"], "x")
 
 	// Calculate the percent complete
 	percentComplete := float64(timeThroughFile) / float64(duration) * 100
@@ -219,6 +117,8 @@ func newProgress(line string, duration time.Duration, startTime time.Time, input
 		Size:                size,
 		Time:                timeThroughFile,
 		Bitrate:             bitrate,
+		DupFrames:           dupFrames,
+		DropFrames:          dropFrames,
 		Speed:               speed,
 		PercentComplete:     percentComplete,
 		TimeRemaining:       timeRemaining,
@@ -226,6 +126,23 @@ func newProgress(line string, duration time.Duration, startTime time.Time, input
 	}, nil
 }
 
+// parseFloatOrNA parses value as a float64 after trimming suffix, treating
+// an absent field or ffmpeg's "N/A" placeholder (routine before the first
+// frame is encoded) as zero rather than a parse error
+func parseFloatOrNA(value string, suffix string) float64 {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "N/A" {
+		return 0
+	}
+
+	parsed, err := strconv.ParseFloat(strings.TrimSuffix(value, suffix), 64)
+	if err != nil {
+		return 0
+	}
+
+	return parsed
+}
+
 // String method for the Progress struct
 func (p Progress) String() string {
 	return strconv.FormatFloat(p.PercentComplete, 'f', 2, 64) + "% Complete - " + "Time Remaining: " + p.TimeRemaining.Truncate(time.Second).String() + " - Estimated Finish Time: " + p.EstimatedFinishTime.Format(time.TimeOnly)
@@ -0,0 +1,249 @@
+package go_ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ThumbnailOptions configures ExtractThumbnail
+type ThumbnailOptions struct {
+	// Width of the extracted thumbnail in pixels. Zero derives the width
+	// from Height to keep the input's aspect ratio, or keeps the input's
+	// width when Height is also zero
+	Width int
+
+	// Height of the extracted thumbnail in pixels. Zero derives the height
+	// from Width to keep the input's aspect ratio, or keeps the input's
+	// height when Width is also zero
+	Height int
+
+	// Format the thumbnail is encoded as, "jpeg" or "webp". Defaults to "jpeg"
+	Format string
+
+	// Quality passed to the JPEG encoder's -q:v, 2 (best) to 31 (worst).
+	// Zero uses ffmpeg's default
+	JPEGQuality int
+}
+
+// SpriteOptions configures ExtractSprites
+type SpriteOptions struct {
+	// Interval between sprite frames
+	Interval time.Duration
+
+	// TileWidth of each frame within the sprite image, in pixels
+	TileWidth int
+
+	// TileHeight of each frame within the sprite image, in pixels
+	TileHeight int
+
+	// Columns of frames per sprite tile
+	Columns int
+
+	// Rows of frames per sprite tile
+	Rows int
+
+	// Format the sprite image is encoded as, "jpeg" or "webp". Defaults to "jpeg"
+	Format string
+
+	// Quality passed to the JPEG encoder's -q:v, 2 (best) to 31 (worst).
+	// Zero uses ffmpeg's default
+	JPEGQuality int
+}
+
+// SpriteResult is the output of ExtractSprites
+type SpriteResult struct {
+	// Images holds the encoded bytes of each sprite tile, in order
+	Images [][]byte
+
+	// TileWidth of each frame within a sprite image, in pixels
+	TileWidth int
+
+	// TileHeight of each frame within a sprite image, in pixels
+	TileHeight int
+
+	// Columns of frames per sprite tile
+	Columns int
+
+	// Rows of frames per sprite tile
+	Rows int
+
+	// WebVTT is a cue list mapping timestamps to #xywh= fragments
+	// identifying each frame within Images
+	WebVTT string
+}
+
+// ExtractThumbnail runs a single ffmpeg invocation to decode the frame at
+// "at" and return it encoded according to opts
+func ExtractThumbnail(ctx context.Context, inputFile string, at time.Duration, opts ThumbnailOptions) ([]byte, error) {
+	format := opts.Format
+	if format == "" {
+		format = "jpeg"
+	}
+
+	codec, ok := imageCodecs[format]
+	if !ok {
+		return nil, ErrUnsupportedImageFormat
+	}
+
+	args := []string{
+		"-ss", formatSeconds(at),
+		"-i", inputFile,
+		"-frames:v", "1",
+	}
+
+	if opts.Width != 0 || opts.Height != 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:%d", scaleDimension(opts.Width), scaleDimension(opts.Height)))
+	}
+
+	args = append(args, "-c:v", codec)
+
+	if format == "jpeg" && opts.JPEGQuality != 0 {
+		args = append(args, "-q:v", fmt.Sprintf("%d", opts.JPEGQuality))
+	}
+
+	args = append(args, "-f", "image2pipe", "pipe:1")
+
+	output, err := exec.CommandContext(ctx, currentBinaries().FfmpegPath, args...).Output()
+	if err != nil {
+		return nil, ErrThumbnailExtraction
+	}
+
+	return output, nil
+}
+
+// ExtractSprites builds one or more tiled sprite sheets covering inputFile
+// at opts.Interval, returning the tile geometry and a WEBVTT cue list
+// mapping timestamps to #xywh= fragments in the sprite images
+func ExtractSprites(ctx context.Context, inputFile string, opts SpriteOptions) (SpriteResult, error) {
+	format := opts.Format
+	if format == "" {
+		format = "jpeg"
+	}
+
+	codec, ok := imageCodecs[format]
+	if !ok {
+		return SpriteResult{}, ErrUnsupportedImageFormat
+	}
+
+	if opts.Interval <= 0 {
+		return SpriteResult{}, ErrInvalidSpriteInterval
+	}
+
+	duration, err := probeDuration(inputFile, currentBinaries().FfprobePath)
+	if err != nil {
+		return SpriteResult{}, err
+	}
+
+	framesPerTile := opts.Columns * opts.Rows
+	if framesPerTile == 0 {
+		return SpriteResult{}, ErrInvalidSpriteGrid
+	}
+
+	totalFrames := int(duration/opts.Interval) + 1
+	tileCount := (totalFrames + framesPerTile - 1) / framesPerTile
+
+	result := SpriteResult{
+		TileWidth:  opts.TileWidth,
+		TileHeight: opts.TileHeight,
+		Columns:    opts.Columns,
+		Rows:       opts.Rows,
+	}
+
+	var webVTT strings.Builder
+	webVTT.WriteString("WEBVTT\n\n")
+
+	for tile := 0; tile < tileCount; tile++ {
+		tileStart := time.Duration(tile*framesPerTile) * opts.Interval
+
+		args := []string{
+			"-ss", formatSeconds(tileStart),
+			"-i", inputFile,
+			"-frames:v", "1",
+			"-vf", fmt.Sprintf(
+				"fps=1/%f,scale=%d:%d,tile=%dx%d",
+				opts.Interval.Seconds(), opts.TileWidth, opts.TileHeight, opts.Columns, opts.Rows,
+			),
+			"-c:v", codec,
+		}
+
+		if format == "jpeg" && opts.JPEGQuality != 0 {
+			args = append(args, "-q:v", fmt.Sprintf("%d", opts.JPEGQuality))
+		}
+
+		args = append(args, "-f", "image2pipe", "pipe:1")
+
+		image, err := exec.CommandContext(ctx, currentBinaries().FfmpegPath, args...).Output()
+		if err != nil {
+			return SpriteResult{}, ErrSpriteExtraction
+		}
+
+		result.Images = append(result.Images, image)
+
+		framesInTile := framesPerTile
+		if remaining := totalFrames - tile*framesPerTile; remaining < framesInTile {
+			framesInTile = remaining
+		}
+
+		for frame := 0; frame < framesInTile; frame++ {
+			cueStart := tileStart + time.Duration(frame)*opts.Interval
+			cueEnd := cueStart + opts.Interval
+			if cueEnd > duration {
+				cueEnd = duration
+			}
+
+			column := frame % opts.Columns
+			row := frame / opts.Columns
+
+			webVTT.WriteString(fmt.Sprintf(
+				"%s --> %s\nsprite%d.%s#xywh=%d,%d,%d,%d\n\n",
+				formatWebVTTTimestamp(cueStart), formatWebVTTTimestamp(cueEnd),
+				tile, format,
+				column*opts.TileWidth, row*opts.TileHeight, opts.TileWidth, opts.TileHeight,
+			))
+		}
+	}
+
+	result.WebVTT = webVTT.String()
+
+	return result, nil
+}
+
+// imageCodecs maps a sprite/thumbnail Format to the ffmpeg encoder it uses
+var imageCodecs = map[string]string{
+	"jpeg": "mjpeg",
+	"webp": "webp",
+}
+
+// formatSeconds formats d as the fractional-seconds string ffmpeg's -ss expects
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%f", d.Seconds())
+}
+
+// formatWebVTTTimestamp formats d as a WEBVTT HH:MM:SS.mmm timestamp
+func formatWebVTTTimestamp(d time.Duration) string {
+	hours := d / time.Hour
+	d -= hours * time.Hour
+
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+
+	seconds := d / time.Second
+	d -= seconds * time.Second
+
+	milliseconds := d / time.Millisecond
+
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, seconds, milliseconds)
+}
+
+// scaleDimension turns a zero width/height into ffmpeg's "preserve aspect
+// ratio" scale sentinel of -1
+func scaleDimension(dimension int) int {
+	if dimension == 0 {
+		return -1
+	}
+
+	return dimension
+}